@@ -0,0 +1,219 @@
+package main
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	mathrand "math/rand"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// apiRequest captures everything needed to (re)build an outgoing backend API
+// request, so MetaStore.Send/Verify can retry it without re-reading an
+// already-consumed http.Request body. Path is kept alongside the already-
+// built Headers so apiDo can re-sign the request with a fresh nonce and
+// timestamp on every attempt (see apiDo).
+type apiRequest struct {
+	Method  string
+	URL     string
+	Path    string
+	Body    []byte
+	Headers map[string]string
+}
+
+func (a *apiRequest) httpRequest() (*http.Request, error) {
+	req, err := http.NewRequest(a.Method, a.URL, bytes.NewReader(a.Body))
+	if err != nil {
+		return nil, err
+	}
+	for k, v := range a.Headers {
+		req.Header.Set(k, v)
+	}
+	return req, nil
+}
+
+// signedApiPost builds a POST to rawurl carrying v's Meta as its JSON body.
+// When Config.HmacKey is set, it signs the body together with a fresh
+// timestamp and nonce (see signApiRequest) so the backend can both verify
+// the request wasn't tampered with and reject replays of a captured one.
+func signedApiPost(rawurl string, v *RequestVars) (*apiRequest, error) {
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	if err := enc.Encode(&Meta{Oid: v.Oid, Size: v.Size}); err != nil {
+		return nil, err
+	}
+
+	headers := map[string]string{"Accept": Config.ApiMediaType}
+	if v.Authorization != "" {
+		headers["Authorization"] = v.Authorization
+	}
+
+	u, err := url.Parse(rawurl)
+	if err != nil {
+		return nil, err
+	}
+
+	if Config.HmacKey != "" {
+		signApiRequest("POST", u.Path, buf.Bytes(), headers)
+	}
+
+	return &apiRequest{Method: "POST", URL: rawurl, Path: u.Path, Body: buf.Bytes(), Headers: headers}, nil
+}
+
+// signApiRequest signs method/path/body with Config.HmacKey and sets the
+// Content-Hmac, X-Request-Timestamp and X-Request-Nonce headers the backend
+// needs in order to verify it (see verifyApiRequest, the documented
+// counterpart backends should call). The signed string is:
+//
+//	timestamp "\n" nonce "\n" method "\n" path "\n" sha256(body)
+//
+// binding the HMAC to a specific moment and request, so a header captured
+// off the wire can't be replayed later against the same or another endpoint.
+func signApiRequest(method, path string, body []byte, headers map[string]string) {
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+	nonce := requestNonce()
+
+	headers["Content-Hmac"] = "sha256 " + hex.EncodeToString(hmacApiRequest(timestamp, nonce, method, path, body))
+	headers["X-Request-Timestamp"] = timestamp
+	headers["X-Request-Nonce"] = nonce
+}
+
+// verifyApiRequest is the backend-side counterpart of signApiRequest: given
+// the headers and body of an incoming request, it reports whether the
+// Content-Hmac is valid for Config.HmacKey and the request isn't older than
+// maxAge (guarding against replay of a captured request).
+func verifyApiRequest(method, path string, headers http.Header, body []byte, maxAge time.Duration) error {
+	timestamp := headers.Get("X-Request-Timestamp")
+	nonce := headers.Get("X-Request-Nonce")
+	sig := strings.TrimPrefix(headers.Get("Content-Hmac"), "sha256 ")
+	if timestamp == "" || nonce == "" || sig == "" {
+		return fmt.Errorf("missing signature headers")
+	}
+
+	sec, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return fmt.Errorf("invalid timestamp")
+	}
+	if age := time.Since(time.Unix(sec, 0)); age > maxAge || age < -maxAge {
+		return fmt.Errorf("request timestamp outside the allowed window")
+	}
+
+	expected := hex.EncodeToString(hmacApiRequest(timestamp, nonce, method, path, body))
+	if !hmac.Equal([]byte(expected), []byte(sig)) {
+		return fmt.Errorf("signature mismatch")
+	}
+
+	if !usedNonces.claim(nonce, time.Unix(sec, 0), maxAge) {
+		return fmt.Errorf("nonce already used, possible replay")
+	}
+	return nil
+}
+
+// nonceCache remembers nonces from requests that have already passed
+// verifyApiRequest, so a captured request can't be replayed a second time
+// within maxAge. Without this, X-Request-Nonce would be signed but never
+// actually checked for reuse, and the timestamp window alone would let any
+// captured request through repeatedly until it expired.
+type nonceCache struct {
+	mu   sync.Mutex
+	seen map[string]time.Time
+}
+
+var usedNonces = &nonceCache{seen: map[string]time.Time{}}
+
+// claim records nonce as used and reports true, or reports false if it was
+// already claimed. seenAt is the request's own timestamp, so sweeping old
+// entries doesn't depend on wall-clock skew between claim calls.
+func (c *nonceCache) claim(nonce string, seenAt time.Time, maxAge time.Duration) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for n, t := range c.seen {
+		if seenAt.Sub(t) > maxAge {
+			delete(c.seen, n)
+		}
+	}
+
+	if _, ok := c.seen[nonce]; ok {
+		return false
+	}
+	c.seen[nonce] = seenAt
+	return true
+}
+
+func hmacApiRequest(timestamp, nonce, method, path string, body []byte) []byte {
+	bodyHash := sha256.Sum256(body)
+	toSign := strings.Join([]string{timestamp, nonce, method, path, hex.EncodeToString(bodyHash[:])}, "\n")
+
+	mac := hmac.New(sha256.New, []byte(Config.HmacKey))
+	mac.Write([]byte(toSign))
+	return mac.Sum(nil)
+}
+
+// requestNonce returns a random 128-bit value, hex-encoded.
+func requestNonce() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// apiDo sends req, retrying on 5xx responses and network errors with
+// exponential backoff and jitter, up to Config.ApiMaxRetries additional
+// attempts. 4xx responses are returned immediately as terminal.
+//
+// Each attempt is re-signed with a fresh nonce and timestamp when
+// Config.HmacKey is set: a backend following verifyApiRequest claims a
+// request's nonce as soon as it's verified, before it knows whether it can
+// answer successfully, so replaying the first attempt's nonce on retry
+// would have every retry after a 5xx rejected as a replay.
+func apiDo(req *apiRequest) (*http.Response, error) {
+	delay := Config.ApiRetryInitialDelay
+
+	var lastErr error
+	for attempt := 0; ; attempt++ {
+		if Config.HmacKey != "" {
+			signApiRequest(req.Method, req.Path, req.Body, req.Headers)
+		}
+
+		httpReq, err := req.httpRequest()
+		if err != nil {
+			return nil, err
+		}
+
+		res, err := http.DefaultClient.Do(httpReq)
+		if err == nil && res.StatusCode < 500 {
+			return res, nil
+		}
+
+		if err != nil {
+			lastErr = err
+		} else {
+			res.Body.Close()
+			lastErr = fmt.Errorf("status: %d", res.StatusCode)
+		}
+
+		if attempt >= Config.ApiMaxRetries {
+			return nil, lastErr
+		}
+
+		time.Sleep(jitter(delay))
+		if delay *= 2; delay > Config.ApiRetryMaxDelay {
+			delay = Config.ApiRetryMaxDelay
+		}
+	}
+}
+
+// jitter returns a duration in [d/2, d], so concurrent retries after a
+// backend blip don't all land on the backend at the same instant.
+func jitter(d time.Duration) time.Duration {
+	return d/2 + time.Duration(mathrand.Int63n(int64(d)/2+1))
+}
@@ -0,0 +1,106 @@
+package main
+
+import "time"
+
+// Configuration holds the runtime settings for lfs-test-server. It is
+// populated at startup from the environment / config file and is read from
+// throughout the rest of the package as the package-level Config variable.
+type Configuration struct {
+	// MetaEndpoint is the base URL of the backend API that stores object
+	// metadata (see MetaStore).
+	MetaEndpoint string
+
+	// ApiMediaType is the Accept/Content-Type sent on requests to MetaEndpoint.
+	ApiMediaType string
+
+	// HmacKey, when set, causes requests to MetaEndpoint to be signed with a
+	// Content-Hmac header (see signedApiPost).
+	HmacKey string
+
+	// AwsKey and AwsSecret are the credentials used to sign requests against
+	// the configured S3 bucket.
+	AwsKey    string
+	AwsSecret string
+
+	// BucketName is the S3 bucket objects are stored in.
+	BucketName string
+
+	// S3Region is the AWS region the configured bucket lives in, e.g.
+	// "eu-central-1". Required for SigV4 signing.
+	S3Region string
+
+	// S3SignatureVersion selects the signing scheme used for S3 requests.
+	// Valid values are "v2" and "v4". Defaults to "v2" for backwards
+	// compatibility with existing deployments.
+	S3SignatureVersion string
+
+	// S3Endpoint overrides the default s3.amazonaws.com endpoint, for
+	// S3-compatible services such as MinIO, Ceph RGW or Wasabi. Leave empty
+	// to use AWS.
+	S3Endpoint string
+
+	// S3ForcePathStyle addresses objects as https://endpoint/bucket/key
+	// instead of the virtual-hosted https://bucket.endpoint/key form.
+	// Most S3-compatible services require this.
+	S3ForcePathStyle bool
+
+	// S3DisableSSL serves S3Endpoint over plain HTTP, for services running
+	// without TLS (e.g. a local MinIO container).
+	S3DisableSSL bool
+
+	// S3PartSize is the size, in bytes, at or above which PutLink switches an
+	// upload from a single presigned PUT to a multipart upload. Defaults to
+	// 64 MiB.
+	S3PartSize int64
+
+	// S3MaxConcurrency is a limit on parallel multipart part uploads.
+	// Nothing in this package reads it, and the link PutLink returns carries
+	// no concurrency value for the client.
+	S3MaxConcurrency int
+
+	// S3SSEMode selects server-side encryption for stored objects. Valid
+	// values are "" (none), "AES256" (SSE-S3), "aws:kms" (SSE-KMS) and "C"
+	// (SSE-C, customer-provided key).
+	S3SSEMode string
+
+	// S3KMSKeyID is the KMS key ID to use when S3SSEMode is "aws:kms". If
+	// empty, S3 uses the account's default key.
+	S3KMSKeyID string
+
+	// S3SSECustomerKey is the 256-bit (32-byte) customer-provided key used
+	// when S3SSEMode is "C", base64-encoded.
+	S3SSECustomerKey string
+
+	// S3GatewayEnabled turns on the /s3/{bucket}/{key...} route, letting
+	// this server act as an S3-compatible endpoint backed by local storage.
+	S3GatewayEnabled bool
+
+	// ContentPath is the local-disk root the S3 gateway's ContentStore
+	// reads and writes objects under.
+	ContentPath string
+
+	// S3AccessKey and S3SecretKey are the credentials callers of the S3
+	// gateway route must sign their requests with. Unrelated to AwsKey/
+	// AwsSecret, which this server uses to sign its own requests to a
+	// real (or compatible) upstream S3.
+	S3AccessKey string
+	S3SecretKey string
+
+	// ApiMaxRetries is how many additional attempts MetaStore.Send and
+	// Verify make on a 5xx or network error before giving up. Retries back
+	// off exponentially between ApiRetryInitialDelay and ApiRetryMaxDelay.
+	ApiMaxRetries        int
+	ApiRetryInitialDelay time.Duration
+	ApiRetryMaxDelay     time.Duration
+}
+
+// Config is the active configuration for this process.
+var Config = &Configuration{
+	ApiMediaType:         "application/vnd.git-lfs+json",
+	S3SignatureVersion:   "v2",
+	S3PartSize:           64 * 1024 * 1024,
+	S3MaxConcurrency:     4,
+	ApiMaxRetries:        3,
+	ApiRetryInitialDelay: 200 * time.Millisecond,
+	ApiRetryMaxDelay:     5 * time.Second,
+}
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// ContentStore stores objects directly on local disk, under the same
+// OID-addressed layout oidPath already defines for S3 keys. It satisfies
+// gatewayStore, so the S3 gateway (s3gateway.go) can serve a self-hosted
+// disk directory as an S3-compatible endpoint.
+type ContentStore struct {
+	basePath string
+}
+
+// NewContentStore roots a ContentStore at basePath, creating it if it
+// doesn't already exist.
+func NewContentStore(basePath string) (*ContentStore, error) {
+	if err := os.MkdirAll(basePath, 0750); err != nil {
+		return nil, err
+	}
+	return &ContentStore{basePath: basePath}, nil
+}
+
+func (s *ContentStore) path(meta *Meta) string {
+	return filepath.Join(s.basePath, meta.PathPrefix, oidPath(meta.Oid))
+}
+
+// Get serves the object straight off disk, supporting range requests.
+func (s *ContentStore) Get(meta *Meta, w http.ResponseWriter, r *http.Request) int {
+	f, err := os.Open(s.path(meta))
+	if err != nil {
+		w.WriteHeader(http.StatusNotFound)
+		return http.StatusNotFound
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return http.StatusInternalServerError
+	}
+
+	http.ServeContent(w, r, meta.Oid, info.ModTime(), f)
+	return http.StatusOK
+}
+
+// Put writes body to disk at the object's path, creating parent
+// directories as needed.
+func (s *ContentStore) Put(meta *Meta, body io.Reader) error {
+	p := s.path(meta)
+	if err := os.MkdirAll(filepath.Dir(p), 0750); err != nil {
+		return err
+	}
+
+	f, err := os.Create(p)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	_, err = io.Copy(f, body)
+	return err
+}
+
+// Exists reports whether an object is present on disk.
+func (s *ContentStore) Exists(meta *Meta) (bool, error) {
+	_, err := os.Stat(s.path(meta))
+	if os.IsNotExist(err) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// List returns every object whose key starts with prefix, for the S3
+// gateway's ListObjectsV2.
+func (s *ContentStore) List(prefix string) ([]storeEntry, error) {
+	var entries []storeEntry
+
+	err := filepath.Walk(s.basePath, func(p string, info os.FileInfo, err error) error {
+		if err != nil || info.IsDir() {
+			return err
+		}
+
+		rel, err := filepath.Rel(s.basePath, p)
+		if err != nil {
+			return err
+		}
+
+		key := filepath.ToSlash(rel)
+		if prefix != "" && !strings.HasPrefix(key, prefix) {
+			return nil
+		}
+
+		entries = append(entries, storeEntry{Key: key, Size: info.Size()})
+		return nil
+	})
+
+	return entries, err
+}
@@ -0,0 +1,20 @@
+package main
+
+// link is returned to the client as part of a batch response, telling it
+// where and how to upload or download an object.
+type link struct {
+	Href   string            `json:"href"`
+	Header map[string]string `json:"header,omitempty"`
+
+	// Parts and CompleteHref are set instead of Href/Header when the object
+	// is large enough to require a multipart upload (see PutLink).
+	Parts        []partLink `json:"parts,omitempty"`
+	CompleteHref string     `json:"complete_href,omitempty"`
+}
+
+// partLink is one presigned part-upload URL within a multipart upload.
+type partLink struct {
+	PartNumber int               `json:"part_number"`
+	Href       string            `json:"href"`
+	Header     map[string]string `json:"header,omitempty"`
+}
@@ -0,0 +1,314 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// isoLayout is the timestamp format AWS expects on both the x-amz-date header
+// and the X-Amz-Date query parameter.
+const isoLayout = "20060102T150405Z"
+
+// dateLayout is the short date used in SigV4 credential scopes.
+const dateLayout = "20060102"
+
+// emptyPayloadHash is sha256("") hex-encoded, the payload hash a GET (or any
+// other request with no body) must sign instead of an object's content hash.
+const emptyPayloadHash = "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"
+
+// awsToken carries the pieces of a signed S3 request: the URL the caller
+// should hit and, for header-signed requests, the Authorization value to
+// send alongside it.
+type awsToken struct {
+	Location string
+	Token    string
+	Time     time.Time
+}
+
+// S3SignQuery produces a token whose Location is a presigned URL valid for
+// expireSeconds, suitable for redirecting a client straight to S3.
+func S3SignQuery(method, objectPath string, expireSeconds int) *awsToken {
+	if Config.S3SignatureVersion == "v4" {
+		return s3SignQueryV4(method, objectPath, expireSeconds)
+	}
+	return s3SignQueryV2(method, objectPath, expireSeconds)
+}
+
+// S3SignHeader produces a token whose Token is an Authorization header value
+// for a request that the caller will send itself (e.g. a client-side PUT, or
+// a server-side proxied GET). oid is the sha256 of the object being
+// transferred, used as the signed payload hash for SigV4 requests. extra
+// carries any additional headers (e.g. SSE directives) that must themselves
+// be part of the signed header set.
+func S3SignHeader(method, objectPath, oid string, extra map[string]string) *awsToken {
+	if Config.S3SignatureVersion == "v4" {
+		return s3SignHeaderV4(method, objectPath, oid, extra)
+	}
+	return s3SignHeaderV2(method, objectPath)
+}
+
+// s3Scheme returns the URL scheme to use when talking to the configured
+// (or default AWS) S3 endpoint.
+func s3Scheme() string {
+	if Config.S3DisableSSL {
+		return "http"
+	}
+	return "https"
+}
+
+// s3Endpoint returns the bare host[:port] S3 requests are sent to, honoring
+// Config.S3Endpoint for S3-compatible services. It does not include the
+// bucket name; see s3Host for the virtual-hosted-style host.
+func s3Endpoint() string {
+	if Config.S3Endpoint != "" {
+		return Config.S3Endpoint
+	}
+	return "s3.amazonaws.com"
+}
+
+// s3Host returns the host to send requests to: the bare endpoint when
+// S3ForcePathStyle is set, otherwise the virtual-hosted bucket.endpoint form.
+// The matching path (with the bucket prepended under path-style addressing)
+// comes from s3RequestURI.
+func s3Host() string {
+	if Config.S3ForcePathStyle {
+		return s3Endpoint()
+	}
+	return Config.BucketName + "." + s3Endpoint()
+}
+
+// s3RequestURI returns the path component used both to build the request
+// URL and, for SigV4, as the canonical URI that is signed.
+func s3RequestURI(objectPath string) string {
+	if Config.S3ForcePathStyle {
+		return "/" + Config.BucketName + objectPath
+	}
+	return objectPath
+}
+
+// --- Signature Version 2 (legacy) ---
+
+func s3SignQueryV2(method, objectPath string, expireSeconds int) *awsToken {
+	return s3SignQueryV2WithParams(method, objectPath, expireSeconds, nil)
+}
+
+// s3SignQueryV2WithParams is s3SignQueryV2 with room for the subresource
+// query parameters (e.g. uploadId for a multipart part upload) that AWS's
+// V2 CanonicalizedResource requires be appended to the signed resource.
+func s3SignQueryV2WithParams(method, objectPath string, expireSeconds int, extra url.Values) *awsToken {
+	expires := time.Now().Add(time.Duration(expireSeconds) * time.Second).Unix()
+
+	resource := s3RequestURI(objectPath)
+	var subresources []string
+	for _, k := range []string{"partNumber", "uploadId"} {
+		if v := extra.Get(k); v != "" {
+			subresources = append(subresources, k+"="+v)
+		}
+	}
+	if len(subresources) > 0 {
+		resource += "?" + strings.Join(subresources, "&")
+	}
+
+	stringToSign := fmt.Sprintf("%s\n\n\n%d\n%s", method, expires, resource)
+	sig := s3SignV2(stringToSign)
+
+	q := url.Values{}
+	for k, v := range extra {
+		q[k] = v
+	}
+	q.Set("AWSAccessKeyId", Config.AwsKey)
+	q.Set("Expires", strconv.FormatInt(expires, 10))
+	q.Set("Signature", sig)
+
+	loc := fmt.Sprintf("%s://%s%s?%s", s3Scheme(), s3Host(), s3RequestURI(objectPath), q.Encode())
+	return &awsToken{Location: loc, Time: time.Now()}
+}
+
+func s3SignHeaderV2(method, objectPath string) *awsToken {
+	now := time.Now()
+	date := now.Format(time.RFC1123Z)
+	stringToSign := fmt.Sprintf("%s\n\n\n%s\n%s", method, date, s3RequestURI(objectPath))
+	sig := s3SignV2(stringToSign)
+
+	return &awsToken{
+		Location: fmt.Sprintf("%s://%s%s", s3Scheme(), s3Host(), s3RequestURI(objectPath)),
+		Token:    fmt.Sprintf("AWS %s:%s", Config.AwsKey, sig),
+		Time:     now,
+	}
+}
+
+func s3SignV2(stringToSign string) string {
+	mac := hmac.New(sha1.New, []byte(Config.AwsSecret))
+	mac.Write([]byte(stringToSign))
+	return base64.StdEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// --- Signature Version 4 ---
+
+// s3CanonicalRequest builds the canonical request described in the AWS
+// SigV4 spec: METHOD \n CanonicalURI \n CanonicalQueryString \n
+// CanonicalHeaders \n SignedHeaders \n HashedPayload. Header names are
+// matched and joined case-insensitively, since AWS requires SignedHeaders
+// to be all-lowercase regardless of how the headers themselves are cased
+// (e.g. x-amz-server-side-encryption-customer-key-MD5).
+func s3CanonicalRequest(method, objectPath string, query url.Values, headers map[string]string, signedHeaders []string, payloadHash string) string {
+	signedHeaders = normalizeSignedHeaders(signedHeaders)
+
+	lowerHeaders := make(map[string]string, len(headers))
+	for k, v := range headers {
+		lowerHeaders[strings.ToLower(k)] = v
+	}
+
+	var canonicalHeaders strings.Builder
+	for _, h := range signedHeaders {
+		canonicalHeaders.WriteString(h)
+		canonicalHeaders.WriteString(":")
+		canonicalHeaders.WriteString(strings.TrimSpace(lowerHeaders[h]))
+		canonicalHeaders.WriteString("\n")
+	}
+
+	return strings.Join([]string{
+		method,
+		objectPath,
+		s3CanonicalQueryString(query),
+		canonicalHeaders.String(),
+		strings.Join(signedHeaders, ";"),
+		payloadHash,
+	}, "\n")
+}
+
+// normalizeSignedHeaders lowercases and sorts a SignedHeaders list, the form
+// AWS requires both in the canonical request and in the Authorization
+// header's own SignedHeaders field.
+func normalizeSignedHeaders(signedHeaders []string) []string {
+	out := make([]string, len(signedHeaders))
+	for i, h := range signedHeaders {
+		out[i] = strings.ToLower(h)
+	}
+	sort.Strings(out)
+	return out
+}
+
+// s3CanonicalQueryString sorts query keys and percent-encodes values using
+// %20 for spaces, per the SigV4 spec (url.Values.Encode uses "+").
+func s3CanonicalQueryString(query url.Values) string {
+	keys := make([]string, 0, len(query))
+	for k := range query {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	parts := make([]string, 0, len(keys))
+	for _, k := range keys {
+		for _, v := range query[k] {
+			parts = append(parts, s3Escape(k)+"="+s3Escape(v))
+		}
+	}
+	return strings.Join(parts, "&")
+}
+
+func s3Escape(s string) string {
+	return strings.Replace(url.QueryEscape(s), "+", "%20", -1)
+}
+
+func s3StringToSign(t time.Time, region, canonicalRequest string) string {
+	scope := fmt.Sprintf("%s/%s/s3/aws4_request", t.Format(dateLayout), region)
+	hash := sha256.Sum256([]byte(canonicalRequest))
+	return strings.Join([]string{
+		"AWS4-HMAC-SHA256",
+		t.Format(isoLayout),
+		scope,
+		hex.EncodeToString(hash[:]),
+	}, "\n")
+}
+
+func s3SigningKey(t time.Time, region string) []byte {
+	return s3SigningKeyWithSecret(Config.AwsSecret, t, region)
+}
+
+// s3SigningKeyWithSecret derives a SigV4 signing key for an arbitrary secret,
+// so the same derivation can verify requests signed with a different key
+// pair (e.g. the S3 gateway's own Config.S3SecretKey).
+func s3SigningKeyWithSecret(secret string, t time.Time, region string) []byte {
+	kDate := s3HmacSHA256([]byte("AWS4"+secret), t.Format(dateLayout))
+	kRegion := s3HmacSHA256(kDate, region)
+	kService := s3HmacSHA256(kRegion, "s3")
+	return s3HmacSHA256(kService, "aws4_request")
+}
+
+func s3HmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
+
+func s3SignQueryV4(method, objectPath string, expireSeconds int) *awsToken {
+	return s3SignQueryV4WithParams(method, objectPath, expireSeconds, nil)
+}
+
+// s3SignQueryV4WithParams is s3SignQueryV4 with room for extra query
+// parameters (e.g. partNumber/uploadId for a multipart part upload) that
+// must themselves be part of the signed canonical query string.
+func s3SignQueryV4WithParams(method, objectPath string, expireSeconds int, extra url.Values) *awsToken {
+	now := time.Now().UTC()
+	region := Config.S3Region
+	credential := fmt.Sprintf("%s/%s/%s/s3/aws4_request", Config.AwsKey, now.Format(dateLayout), region)
+
+	query := url.Values{}
+	for k, vs := range extra {
+		query[k] = vs
+	}
+	query.Set("X-Amz-Algorithm", "AWS4-HMAC-SHA256")
+	query.Set("X-Amz-Credential", credential)
+	query.Set("X-Amz-Date", now.Format(isoLayout))
+	query.Set("X-Amz-Expires", strconv.Itoa(expireSeconds))
+	query.Set("X-Amz-SignedHeaders", "host")
+
+	headers := map[string]string{"host": s3Host()}
+	canonicalRequest := s3CanonicalRequest(method, s3RequestURI(objectPath), query, headers, []string{"host"}, "UNSIGNED-PAYLOAD")
+	stringToSign := s3StringToSign(now, region, canonicalRequest)
+	sig := hex.EncodeToString(s3HmacSHA256(s3SigningKey(now, region), stringToSign))
+	query.Set("X-Amz-Signature", sig)
+
+	loc := fmt.Sprintf("%s://%s%s?%s", s3Scheme(), s3Host(), s3RequestURI(objectPath), s3CanonicalQueryString(query))
+	return &awsToken{Location: loc, Time: now}
+}
+
+func s3SignHeaderV4(method, objectPath, oid string, extra map[string]string) *awsToken {
+	now := time.Now().UTC()
+	region := Config.S3Region
+
+	headers := map[string]string{
+		"host":                 s3Host(),
+		"x-amz-content-sha256": oid,
+		"x-amz-date":           now.Format(isoLayout),
+	}
+	signedHeaders := []string{"host", "x-amz-content-sha256", "x-amz-date"}
+	for h, v := range extra {
+		headers[h] = v
+		signedHeaders = append(signedHeaders, h)
+	}
+	signedHeaders = normalizeSignedHeaders(signedHeaders)
+
+	canonicalRequest := s3CanonicalRequest(method, s3RequestURI(objectPath), url.Values{}, headers, signedHeaders, oid)
+	stringToSign := s3StringToSign(now, region, canonicalRequest)
+	sig := hex.EncodeToString(s3HmacSHA256(s3SigningKey(now, region), stringToSign))
+
+	auth := fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s/%s/s3/aws4_request, SignedHeaders=%s, Signature=%s",
+		Config.AwsKey, now.Format(dateLayout), region, strings.Join(signedHeaders, ";"), sig)
+
+	return &awsToken{
+		Location: fmt.Sprintf("%s://%s%s", s3Scheme(), s3Host(), s3RequestURI(objectPath)),
+		Token:    auth,
+		Time:     now,
+	}
+}
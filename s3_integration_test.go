@@ -0,0 +1,80 @@
+package main
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"os"
+	"testing"
+)
+
+// TestMinIOPresignedRoundTrip exercises a real presigned PUT followed by a
+// presigned GET against a MinIO (or other S3-compatible) endpoint, per the
+// original request's acceptance criterion. It only runs when
+// LFS_TEST_S3_ENDPOINT is set, e.g. pointed at a local MinIO container:
+//
+//	docker run -p 9000:9000 -e MINIO_ROOT_USER=minioadmin -e MINIO_ROOT_PASSWORD=minioadmin minio/minio server /data
+//	LFS_TEST_S3_ENDPOINT=localhost:9000 go test -run TestMinIOPresignedRoundTrip
+//
+// No MinIO container is available in this sandbox, so the test skips itself
+// rather than failing when that environment isn't provided.
+func TestMinIOPresignedRoundTrip(t *testing.T) {
+	endpoint := os.Getenv("LFS_TEST_S3_ENDPOINT")
+	if endpoint == "" {
+		t.Skip("LFS_TEST_S3_ENDPOINT not set; skipping MinIO integration test")
+	}
+
+	saved := *Config
+	defer func() { *Config = saved }()
+
+	Config.S3Endpoint = endpoint
+	Config.BucketName = envOrDefault("LFS_TEST_S3_BUCKET", "test-bucket")
+	Config.AwsKey = envOrDefault("LFS_TEST_S3_ACCESS_KEY", "minioadmin")
+	Config.AwsSecret = envOrDefault("LFS_TEST_S3_SECRET_KEY", "minioadmin")
+	Config.S3Region = envOrDefault("LFS_TEST_S3_REGION", "us-east-1")
+	Config.S3SignatureVersion = "v4"
+	Config.S3ForcePathStyle = true
+	Config.S3DisableSSL = true
+
+	objectPath := "/integration-test-object"
+	body := []byte("hello from the presigned round-trip test")
+
+	putToken := S3SignQuery("PUT", objectPath, 60)
+	putReq, err := http.NewRequest("PUT", putToken.Location, bytes.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	putRes, err := http.DefaultClient.Do(putReq)
+	if err != nil {
+		t.Fatalf("presigned PUT: %v", err)
+	}
+	putRes.Body.Close()
+	if putRes.StatusCode != http.StatusOK {
+		t.Fatalf("presigned PUT status = %d, want 200", putRes.StatusCode)
+	}
+
+	getToken := S3SignQuery("GET", objectPath, 60)
+	getRes, err := http.Get(getToken.Location)
+	if err != nil {
+		t.Fatalf("presigned GET: %v", err)
+	}
+	defer getRes.Body.Close()
+	if getRes.StatusCode != http.StatusOK {
+		t.Fatalf("presigned GET status = %d, want 200", getRes.StatusCode)
+	}
+
+	got, err := io.ReadAll(getRes.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, body) {
+		t.Fatalf("round-tripped body = %q, want %q", got, body)
+	}
+}
+
+func envOrDefault(key, def string) string {
+	if v := os.Getenv(key); v != "" {
+		return v
+	}
+	return def
+}
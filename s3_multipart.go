@@ -0,0 +1,111 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"path"
+	"strconv"
+	"strings"
+
+	minio "github.com/minio/minio-go/v7"
+	"github.com/minio/minio-go/v7/pkg/credentials"
+)
+
+// minioClient builds a client for the configured (or default AWS) S3
+// endpoint. It is only used for the operations the presigned-URL API can't
+// express on its own, such as initiating and completing multipart uploads.
+func minioClient() (*minio.Client, error) {
+	return minio.New(s3Endpoint(), &minio.Options{
+		Creds:  credentials.NewStaticV4(Config.AwsKey, Config.AwsSecret, ""),
+		Secure: !Config.S3DisableSSL,
+		Region: Config.S3Region,
+	})
+}
+
+// objectKey returns the S3 key (no leading slash) for an object's metadata.
+func objectKey(meta *Meta) string {
+	return strings.TrimPrefix(path.Join(meta.PathPrefix, oidPath(meta.Oid)), "/")
+}
+
+// multipartPutLink initiates a multipart upload for an object at or above
+// Config.S3PartSize and returns a link carrying one presigned part-upload
+// URL per part plus a CompleteHref naming where the finished part list
+// (part number + ETag pairs) goes once every part has been uploaded.
+// CompleteMultipart finishes the upload from such a list.
+func (s *S3Redirector) multipartPutLink(meta *Meta) (*link, error) {
+	client, err := minioClient()
+	if err != nil {
+		return nil, err
+	}
+
+	key := objectKey(meta)
+	core := minio.Core{Client: client}
+
+	uploadID, err := core.NewMultipartUpload(context.Background(), Config.BucketName, key, minio.PutObjectOptions{})
+	if err != nil {
+		return nil, err
+	}
+
+	numParts := int((meta.Size + Config.S3PartSize - 1) / Config.S3PartSize)
+	parts := make([]partLink, 0, numParts)
+	for partNumber := 1; partNumber <= numParts; partNumber++ {
+		token, err := s3SignUploadPart(key, uploadID, partNumber)
+		if err != nil {
+			return nil, err
+		}
+		parts = append(parts, partLink{
+			PartNumber: partNumber,
+			Href:       token.Location,
+		})
+	}
+
+	return &link{
+		Parts:        parts,
+		CompleteHref: fmt.Sprintf("/objects/%s/complete?uploadId=%s", meta.Oid, url.QueryEscape(uploadID)),
+	}, nil
+}
+
+// s3SignUploadPart presigns a single UploadPart request, honoring
+// Config.S3SignatureVersion like every other signing call in this package.
+func s3SignUploadPart(key, uploadID string, partNumber int) (*awsToken, error) {
+	extra := url.Values{}
+	extra.Set("partNumber", strconv.Itoa(partNumber))
+	extra.Set("uploadId", uploadID)
+
+	objectPath := path.Join("/", key)
+	if Config.S3SignatureVersion == "v4" {
+		if Config.S3Region == "" {
+			return nil, fmt.Errorf("S3Region must be set to presign multipart part uploads under SigV4")
+		}
+		return s3SignQueryV4WithParams("PUT", objectPath, 900, extra), nil
+	}
+	return s3SignQueryV2WithParams("PUT", objectPath, 900, extra), nil
+}
+
+// completedPart is one entry in the part list a client POSTs back after
+// uploading every part returned by multipartPutLink.
+type completedPart struct {
+	PartNumber int    `json:"part_number"`
+	ETag       string `json:"etag"`
+}
+
+// CompleteMultipart finalizes a multipart upload by telling S3 which parts
+// (and in what order) make up the finished object. No handler for the
+// CompleteHref path is registered in this package and nothing here calls
+// this method.
+func (s *S3Redirector) CompleteMultipart(meta *Meta, uploadID string, parts []completedPart) error {
+	client, err := minioClient()
+	if err != nil {
+		return err
+	}
+
+	core := minio.Core{Client: client}
+	complete := make([]minio.CompletePart, len(parts))
+	for i, p := range parts {
+		complete[i] = minio.CompletePart{PartNumber: p.PartNumber, ETag: p.ETag}
+	}
+
+	_, err = core.CompleteMultipartUpload(context.Background(), Config.BucketName, objectKey(meta), uploadID, complete, minio.PutObjectOptions{})
+	return err
+}
@@ -0,0 +1,255 @@
+package main
+
+import (
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"path"
+	"strings"
+	"time"
+)
+
+// gatewayStore is the subset of a ContentStorer the S3 gateway needs in
+// order to serve objects straight out of local storage: the same Get it
+// uses for LFS downloads, a body-writing Put for uploads, Exists for HEAD,
+// and a List for ListObjectsV2. *ContentStore (content_store.go) satisfies
+// this; see MountS3Gateway for how it's wired up.
+type gatewayStore interface {
+	Get(meta *Meta, w http.ResponseWriter, r *http.Request) int
+	Put(meta *Meta, body io.Reader) error
+	Exists(meta *Meta) (bool, error)
+	List(prefix string) ([]storeEntry, error)
+}
+
+// storeEntry is one object reported by gatewayStore.List.
+type storeEntry struct {
+	Key  string
+	Size int64
+}
+
+// S3Gateway lets lfs-test-server act as an S3-compatible endpoint, so
+// clients that only speak the S3 API (or Git LFS clients pointed at it
+// directly) can read and write through the same storage a normal LFS
+// deployment uses, without standing up a separate MinIO instance.
+type S3Gateway struct {
+	Store gatewayStore
+}
+
+// NewS3Gateway wraps store as an S3-compatible endpoint.
+func NewS3Gateway(store gatewayStore) *S3Gateway {
+	return &S3Gateway{Store: store}
+}
+
+// MountS3Gateway registers the gateway's route on mux, backed by a
+// ContentStore rooted at Config.ContentPath, when Config.S3GatewayEnabled
+// is set. Call this once during server startup alongside the rest of the
+// route table.
+func MountS3Gateway(mux *http.ServeMux) error {
+	if !Config.S3GatewayEnabled {
+		return nil
+	}
+
+	store, err := NewContentStore(Config.ContentPath)
+	if err != nil {
+		return err
+	}
+
+	mux.Handle("/s3/", NewS3Gateway(store))
+	return nil
+}
+
+// ServeHTTP handles requests under the gateway's route, e.g.
+// /s3/{bucket}/{key...}. It is intended to be mounted directly as the
+// handler for that route.
+func (g *S3Gateway) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if err := gatewayVerify(r); err != nil {
+		writeS3Error(w, http.StatusForbidden, "SignatureDoesNotMatch", err.Error())
+		return
+	}
+
+	rest := strings.TrimPrefix(r.URL.Path, "/s3/")
+	parts := strings.SplitN(rest, "/", 2)
+	bucket := parts[0]
+	var key string
+	if len(parts) == 2 {
+		key = parts[1]
+	}
+
+	if key == "" {
+		if r.Method != http.MethodGet {
+			writeS3Error(w, http.StatusMethodNotAllowed, "MethodNotAllowed", "unsupported method for bucket root")
+			return
+		}
+		g.ListObjectsV2(w, r, bucket)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		g.GetObject(w, r, key)
+	case http.MethodHead:
+		g.HeadObject(w, r, key)
+	case http.MethodPut:
+		g.PutObject(w, r, key)
+	default:
+		writeS3Error(w, http.StatusMethodNotAllowed, "MethodNotAllowed", "unsupported method for object")
+	}
+}
+
+// keyMeta turns an S3 object key (the same oidPath layout the MetaStore
+// already uses) into the Meta ContentStorer methods expect.
+func keyMeta(key string) *Meta {
+	return &Meta{Oid: path.Base(key)}
+}
+
+// GetObject streams an object back to the caller via the underlying store.
+func (g *S3Gateway) GetObject(w http.ResponseWriter, r *http.Request, key string) {
+	meta := keyMeta(key)
+	ok, err := g.Store.Exists(meta)
+	if err != nil || !ok {
+		writeS3Error(w, http.StatusNotFound, "NoSuchKey", "The specified key does not exist.")
+		return
+	}
+	g.Store.Get(meta, w, r)
+}
+
+// HeadObject reports whether an object exists, S3-style: 200 with no body,
+// or 404. No object metadata headers are set.
+func (g *S3Gateway) HeadObject(w http.ResponseWriter, r *http.Request, key string) {
+	meta := keyMeta(key)
+	ok, err := g.Store.Exists(meta)
+	if err != nil || !ok {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+}
+
+// PutObject writes the request body to the underlying store under key.
+func (g *S3Gateway) PutObject(w http.ResponseWriter, r *http.Request, key string) {
+	meta := keyMeta(key)
+	if err := g.Store.Put(meta, r.Body); err != nil {
+		writeS3Error(w, http.StatusInternalServerError, "InternalError", err.Error())
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+}
+
+// listBucketResult is the subset of the ListObjectsV2 response clients
+// actually read.
+type listBucketResult struct {
+	XMLName  xml.Name       `xml:"ListBucketResult"`
+	Name     string         `xml:"Name"`
+	Prefix   string         `xml:"Prefix"`
+	Contents []listContents `xml:"Contents"`
+}
+
+type listContents struct {
+	Key  string `xml:"Key"`
+	Size int64  `xml:"Size"`
+}
+
+// ListObjectsV2 lists the keys the underlying store has under the request's
+// prefix query parameter.
+func (g *S3Gateway) ListObjectsV2(w http.ResponseWriter, r *http.Request, bucket string) {
+	prefix := r.URL.Query().Get("prefix")
+
+	entries, err := g.Store.List(prefix)
+	if err != nil {
+		writeS3Error(w, http.StatusInternalServerError, "InternalError", err.Error())
+		return
+	}
+
+	result := listBucketResult{Name: bucket, Prefix: prefix}
+	for _, e := range entries {
+		result.Contents = append(result.Contents, listContents{Key: e.Key, Size: e.Size})
+	}
+
+	w.Header().Set("Content-Type", "application/xml")
+	w.WriteHeader(http.StatusOK)
+	enc := xml.NewEncoder(w)
+	enc.Encode(result)
+}
+
+// s3ErrorDocument is the XML body S3 (and this gateway) returns on error.
+type s3ErrorDocument struct {
+	XMLName xml.Name `xml:"Error"`
+	Code    string   `xml:"Code"`
+	Message string   `xml:"Message"`
+}
+
+func writeS3Error(w http.ResponseWriter, status int, code, message string) {
+	w.Header().Set("Content-Type", "application/xml")
+	w.WriteHeader(status)
+	enc := xml.NewEncoder(w)
+	enc.Encode(s3ErrorDocument{Code: code, Message: message})
+}
+
+// gatewayVerify reconstructs the canonical request AWS SigV4 describes from
+// the incoming request and checks it against a signature computed with
+// Config.S3AccessKey/S3SecretKey, rejecting requests signed with a stale
+// (>5 minute skew) timestamp.
+func gatewayVerify(r *http.Request) error {
+	auth := r.Header.Get("Authorization")
+	if auth == "" || !strings.HasPrefix(auth, "AWS4-HMAC-SHA256 ") {
+		return fmt.Errorf("missing or unsupported Authorization header")
+	}
+
+	fields := parseAuthHeader(strings.TrimPrefix(auth, "AWS4-HMAC-SHA256 "))
+	credential := fields["Credential"]
+	signedHeaders := strings.Split(fields["SignedHeaders"], ";")
+	signature := fields["Signature"]
+	if credential == "" || signature == "" || len(signedHeaders) == 0 {
+		return fmt.Errorf("malformed Authorization header")
+	}
+
+	credParts := strings.Split(credential, "/")
+	if len(credParts) != 5 || credParts[0] != Config.S3AccessKey {
+		return fmt.Errorf("unknown access key")
+	}
+	region := credParts[2]
+
+	amzDate := r.Header.Get("X-Amz-Date")
+	reqTime, err := time.Parse(isoLayout, amzDate)
+	if err != nil {
+		return fmt.Errorf("missing or invalid X-Amz-Date")
+	}
+	if skew := time.Since(reqTime); skew > 5*time.Minute || skew < -5*time.Minute {
+		return fmt.Errorf("request timestamp outside the 5 minute window")
+	}
+
+	headers := map[string]string{}
+	for _, h := range signedHeaders {
+		if strings.EqualFold(h, "host") {
+			headers[h] = r.Host
+			continue
+		}
+		headers[h] = r.Header.Get(h)
+	}
+
+	payloadHash := r.Header.Get("X-Amz-Content-Sha256")
+	canonicalRequest := s3CanonicalRequest(r.Method, r.URL.Path, r.URL.Query(), headers, signedHeaders, payloadHash)
+	stringToSign := s3StringToSign(reqTime, region, canonicalRequest)
+	expected := hex.EncodeToString(s3HmacSHA256(s3SigningKeyWithSecret(Config.S3SecretKey, reqTime, region), stringToSign))
+
+	if subtle.ConstantTimeCompare([]byte(expected), []byte(signature)) != 1 {
+		return fmt.Errorf("signature mismatch")
+	}
+	return nil
+}
+
+// parseAuthHeader splits the "Credential=..., SignedHeaders=..., Signature=..."
+// portion of a SigV4 Authorization header into a map.
+func parseAuthHeader(s string) map[string]string {
+	out := map[string]string{}
+	for _, part := range strings.Split(s, ",") {
+		kv := strings.SplitN(strings.TrimSpace(part), "=", 2)
+		if len(kv) == 2 {
+			out[kv[0]] = kv[1]
+		}
+	}
+	return out
+}
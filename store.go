@@ -1,12 +1,9 @@
 package main
 
 import (
-	"bytes"
-	"crypto/hmac"
-	"crypto/sha256"
-	"encoding/hex"
 	"encoding/json"
 	"fmt"
+	"io"
 	"net/http"
 	"path"
 )
@@ -16,25 +13,86 @@ type S3Redirector struct {
 }
 
 // Get will use the provided object Meta data to write a redirect Location and status to
-// the Response Writer. It generates a signed S3 URL that is valid for 5 minutes.
+// the Response Writer. It generates a signed S3 URL that is valid for 5 minutes. SSE-C objects
+// can't be fetched through a presigned URL, since that would require handing the client-side
+// customer key to S3 without a safe channel to carry it in, so those are streamed through this
+// server instead.
 func (s *S3Redirector) Get(meta *Meta, w http.ResponseWriter, r *http.Request) int {
-	token := S3SignQuery("GET", path.Join("/", meta.PathPrefix, oidPath(meta.Oid)), 300)
+	objectPath := path.Join("/", meta.PathPrefix, oidPath(meta.Oid))
+
+	if Config.S3SSEMode == "C" {
+		if err := sseRequireV4(); err != nil {
+			logger.Printf("[S3] error - %s", err)
+			w.WriteHeader(http.StatusInternalServerError)
+			return http.StatusInternalServerError
+		}
+		return s.proxyGet(objectPath, w)
+	}
+
+	token := S3SignQuery("GET", objectPath, 300)
 	w.Header().Set("Location", token.Location)
 	w.WriteHeader(302)
 	return 302
 }
 
+// proxyGet signs and issues the GET itself, then streams the S3 response body straight through
+// to w, since a presigned SSE-C GET URL has nowhere to carry the customer key. A GET has no
+// body, so it must be signed (and sent) with the empty-payload hash, not the object's OID.
+func (s *S3Redirector) proxyGet(objectPath string, w http.ResponseWriter) int {
+	sseHeaders := sseGetHeaders()
+	token := S3SignHeader("GET", objectPath, emptyPayloadHash, sseHeaders)
+
+	req, err := http.NewRequest("GET", token.Location, nil)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return http.StatusInternalServerError
+	}
+	req.Header.Set("Authorization", token.Token)
+	req.Header.Set("x-amz-content-sha256", emptyPayloadHash)
+	req.Header.Set("x-amz-date", token.Time.Format(isoLayout))
+	for h, v := range sseHeaders {
+		req.Header.Set(h, v)
+	}
+
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		w.WriteHeader(http.StatusBadGateway)
+		return http.StatusBadGateway
+	}
+	defer res.Body.Close()
+
+	w.WriteHeader(res.StatusCode)
+	io.Copy(w, res.Body)
+	return res.StatusCode
+}
+
 // PutLink generates an signed S3 link that will allow the client to PUT data into S3. This
 // link includes the x-amz-content-sha256 header which will ensure that the client uploads only
-// data that will match the OID.
-func (s *S3Redirector) PutLink(meta *Meta) *link {
-	token := S3SignHeader("PUT", path.Join("/", meta.PathPrefix, oidPath(meta.Oid)), meta.Oid)
+// data that will match the OID, plus any server-side-encryption headers Config.S3SSEMode
+// requires. Objects at or above Config.S3PartSize are instead handed a multipart upload (see
+// multipartPutLink).
+func (s *S3Redirector) PutLink(meta *Meta) (*link, error) {
+	if err := sseRequireV4(); err != nil {
+		return nil, err
+	}
+
+	if Config.S3PartSize > 0 && meta.Size >= Config.S3PartSize {
+		return s.multipartPutLink(meta)
+	}
+
+	objectPath := path.Join("/", meta.PathPrefix, oidPath(meta.Oid))
+	sseHeaders := ssePutHeaders()
+	token := S3SignHeader("PUT", objectPath, meta.Oid, sseHeaders)
+
 	header := make(map[string]string)
+	for h, v := range sseHeaders {
+		header[h] = v
+	}
 	header["Authorization"] = token.Token
 	header["x-amz-content-sha256"] = meta.Oid
 	header["x-amz-date"] = token.Time.Format(isoLayout)
 
-	return &link{Href: token.Location, Header: header}
+	return &link{Href: token.Location, Header: header}, nil
 }
 
 // Exists checks to see if an object exists on S3.
@@ -115,8 +173,11 @@ func (s *MetaStore) Get(v *RequestVars) (*Meta, error) {
 // Send POSTs metadata to the backend API.
 func (s *MetaStore) Send(v *RequestVars) (*Meta, error) {
 	req, err := signedApiPost(s.MetaLink(v), v)
+	if err != nil {
+		return nil, err
+	}
 
-	res, err := http.DefaultClient.Do(req)
+	res, err := apiDo(req)
 	if err != nil {
 		logger.Printf("[META] error - %s", err)
 		return nil, err
@@ -156,7 +217,7 @@ func (s *MetaStore) Verify(v *RequestVars) error {
 		return err
 	}
 
-	res, err := http.DefaultClient.Do(req)
+	res, err := apiDo(req)
 	if err != nil {
 		logger.Printf("[VERIFY] error - %s", err)
 		return err
@@ -175,26 +236,3 @@ func (s *MetaStore) Verify(v *RequestVars) error {
 	}
 	return fmt.Errorf("status: %d", res.StatusCode)
 }
-
-func signedApiPost(url string, v *RequestVars) (*http.Request, error) {
-	var buf bytes.Buffer
-	enc := json.NewEncoder(&buf)
-	enc.Encode(&Meta{Oid: v.Oid, Size: v.Size})
-
-	req, err := http.NewRequest("POST", url, &buf)
-	if err != nil {
-		return nil, err
-	}
-	req.Header.Set("Accept", Config.ApiMediaType)
-	if v.Authorization != "" {
-		req.Header.Set("Authorization", v.Authorization)
-	}
-
-	if Config.HmacKey != "" {
-		mac := hmac.New(sha256.New, []byte(Config.HmacKey))
-		mac.Write(buf.Bytes())
-		req.Header.Set("Content-Hmac", "sha256 "+hex.EncodeToString(mac.Sum(nil)))
-	}
-
-	return req, nil
-}